@@ -4,15 +4,27 @@ import (
   "errors"
   "fmt"
   "regexp"
+  "sync"
   "github.com/aws/aws-sdk-go/aws"
   "github.com/aws/aws-sdk-go/aws/session"
   "github.com/aws/aws-sdk-go/service/ec2"
+  "github.com/aws/aws-sdk-go/service/kms"
+  "github.com/aws/aws-sdk-go/service/sts"
+  "github.com/hashicorp/go-multierror"
   "github.com/mitchellh/packer/builder/amazon/common"
   "github.com/mitchellh/packer/helper/config"
   "github.com/mitchellh/packer/packer"
   "github.com/mitchellh/packer/template/interpolate"
 )
 
+// maxConcurrentRegions bounds how many regions are processed at once when an artifact spans multiple regions
+// (via Packer's amazon builder ami_regions option), to avoid overwhelming the AWS API with simultaneous requests.
+const maxConcurrentRegions = 4
+
+// regionAMIRegexp matches the <region>:<ami_id> pairs that Packer's amazon builder emits in the artifact ID,
+// for example "us-east-1:ami-4f8fae2c,ap-southeast-2:ami-7a2c9e11" when ami_regions is used.
+var regionAMIRegexp = regexp.MustCompile(`([a-z0-9-]+):(ami-[a-z0-9]+)`)
+
 // Config is the post-processor configuration with interpolation supported.
 //
 // Supports:
@@ -22,12 +34,40 @@ import (
 // * skip_region_validation
 // * token
 // * profile
+// * snapshot_users
+// * snapshot_groups
+// * dry_run
+// * remove_missing
+// * kms_grant_name_prefix
+// * copy_tags
+// * snapshot_tags
 //
 // See Specifying Amazon Credentials (https://www.packer.io/docs/builders/amazon.html) for details on these config
 // parameters.
 type Config struct {
   common.AccessConfig `mapstructure:",squash"`
 
+  // SnapshotUsers is a list of account IDs to explicitly grant createVolumePermission on the AMI's snapshots,
+  // in addition to whatever accounts already hold launch permission on the AMI itself.
+  SnapshotUsers []string `mapstructure:"snapshot_users"`
+  // SnapshotGroups is a list of groups (for example "all") to explicitly grant createVolumePermission on the
+  // AMI's snapshots, in addition to whatever groups already hold launch permission on the AMI itself.
+  SnapshotGroups []string `mapstructure:"snapshot_groups"`
+  // DryRun, when true, logs the ModifySnapshotAttribute calls this post-processor would make without executing
+  // them.
+  DryRun bool `mapstructure:"dry_run"`
+  // RemoveMissing, when true, removes any createVolumePermission entries on the snapshot that are not part of
+  // the desired set, so the snapshot's ACL converges to exactly what's configured.
+  RemoveMissing bool `mapstructure:"remove_missing"`
+  // KMSGrantNamePrefix is prepended to the name of any KMS grant created for an encrypted snapshot, so grants
+  // created by this post-processor are easy to pick out in `kms list-grants` output.
+  KMSGrantNamePrefix string `mapstructure:"kms_grant_name_prefix"`
+  // CopyTags, when true, copies the source AMI's tags onto each of its snapshots.
+  CopyTags bool `mapstructure:"copy_tags"`
+  // SnapshotTags is a map of tags to apply to each snapshot, in addition to (or instead of) any tags copied
+  // from the source AMI via CopyTags. SnapshotTags take precedence over copied AMI tags with the same key.
+  SnapshotTags map[string]string `mapstructure:"snapshot_tags"`
+
   ctx interpolate.Context
 }
 
@@ -54,41 +94,104 @@ func (p *PostProcessor) Configure(raws ...interface{}) error {
   return nil
 }
 
-// PostProcess parses the AMI ID from the artifact ID, retrieves the launch permissions and block devices for the AMI.
-// For each device that has an EBS snapshot it copies the users and groups of the launch permissions to the
-// create volume permissions of the volume.
+// regionAMI is a single <region>:<ami_id> pair parsed from the artifact ID.
+type regionAMI struct {
+	Region string
+	AMIID  string
+}
+
+// parseRegionAMIs parses every <region>:<ami_id> pair out of the artifact ID. Packer's amazon builder emits a
+// single pair normally, and one pair per region when ami_regions is used to copy the AMI to other regions.
+func parseRegionAMIs(artifactID string) []regionAMI {
+	matches := regionAMIRegexp.FindAllStringSubmatch(artifactID, -1)
+	regionAMIs := make([]regionAMI, 0, len(matches))
+	for _, match := range matches {
+		regionAMIs = append(regionAMIs, regionAMI{Region: match[1], AMIID: match[2]})
+	}
+	return regionAMIs
+}
+
+// PostProcess parses every <region>:<ami_id> pair from the artifact ID, retrieves the launch permissions and
+// block devices for each AMI, and for each device that has an EBS snapshot copies the users and groups of the
+// launch permissions, merged with any explicitly configured snapshot_users/snapshot_groups, to the create volume
+// permissions of the volume. Regions are processed concurrently, bounded by maxConcurrentRegions, since a single
+// AMI copied via ami_regions gets a distinct snapshot per region.
 //
-// AWS artifact ID output has the format of <region>:<ami_id>, for example: ap-southeast-2:ami-4f8fae2c
+// AWS artifact ID output has the format of <region>:<ami_id>[,<region>:<ami_id>...], for example:
+// ap-southeast-2:ami-4f8fae2c or us-east-1:ami-4f8fae2c,ap-southeast-2:ami-7a2c9e11
 func (p *PostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (packer.Artifact, bool, error) {
 
 	ui.Say(fmt.Sprintf("%s", artifact.String()))
 
-	r, _ := regexp.Compile("ami-[a-z0-9]+")
-	amiID := r.FindString(artifact.Id())
-	if amiID == "" {
-		return artifact, false, fmt.Errorf("could not find AMI ID in artifact id '%s'", artifact.Id())
+	regionAMIs := parseRegionAMIs(artifact.Id())
+	if len(regionAMIs) == 0 {
+		return artifact, false, fmt.Errorf("could not find any region:ami_id pairs in artifact id '%s'", artifact.Id())
 	}
 
-	ui.Say(fmt.Sprintf("AMI ID: %s", amiID))
-
 	config, err := p.config.Config()
 	if err != nil {
 		return artifact, false, fmt.Errorf("could not create AWS config: %v", err)
 	}
 
 	session := session.New(config)
-	ec2conn := ec2.New(session)
+	stsconn := sts.New(session)
+
+	callerIdentity, err := stsconn.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		return artifact, false, fmt.Errorf("could not get caller identity: %v", err)
+	}
+	accountID := aws.StringValue(callerIdentity.Account)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentRegions)
+	var mu sync.Mutex
+	var result *multierror.Error
+
+	for _, ra := range regionAMIs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ra regionAMI) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := p.fixSnapshotsForRegion(ui, session, ra.Region, ra.AMIID, accountID); err != nil {
+				mu.Lock()
+				result = multierror.Append(result, fmt.Errorf("%s: %v", ra.Region, err))
+				mu.Unlock()
+			}
+		}(ra)
+	}
+	wg.Wait()
+
+	if result != nil {
+		return artifact, false, result.ErrorOrNil()
+	}
+
+	return artifact, true, nil
+}
+
+// fixSnapshotsForRegion fixes the snapshot permissions for a single region:ami_id pair, using an EC2 client scoped
+// to that region.
+func (p *PostProcessor) fixSnapshotsForRegion(ui packer.Ui, session *session.Session, region string, amiID string, accountID string) error {
+	ui.Say(fmt.Sprintf("AMI ID: %s (region %s)", amiID, region))
+
+	ec2conn := ec2.New(session, aws.NewConfig().WithRegion(region))
+	kmsconn := kms.New(session, aws.NewConfig().WithRegion(region))
 
 	imageAttributeOutput, err := ec2conn.DescribeImageAttribute(&ec2.DescribeImageAttributeInput{
 		Attribute: aws.String(ec2.ImageAttributeNameLaunchPermission),
 		ImageId:   aws.String(amiID),
 	})
 	if err != nil {
-		return artifact, false, fmt.Errorf("could not get image launch permission attribute for image %s: %v", amiID, err)
+		return fmt.Errorf("could not get image launch permission attribute for image %s: %v", amiID, err)
 	}
 	amiPermissions := imageAttributeOutput.LaunchPermissions
 	ui.Say(fmt.Sprintf("AMI permissions: %v", amiPermissions))
 
+	amiPermissions = mergeLaunchPermissions(amiPermissions, p.config.SnapshotUsers, p.config.SnapshotGroups)
+	amiPermissions = filterOwnerPermission(amiPermissions, accountID)
+	ui.Say(fmt.Sprintf("Desired snapshot permissions (AMI permissions merged with snapshot_users/snapshot_groups): %v", amiPermissions))
+
 	// Cannot call DescribeImageAttribute to retreive the block device mappings since we'll get the following error when
 	// we do: AuthFailure: Unauthorized attempt to access restricted resource
 	// Documented workaround is to run DescribeImages() instead
@@ -96,17 +199,68 @@ func (p *PostProcessor) PostProcess(ui packer.Ui, artifact packer.Artifact) (pac
 		ImageIds: []*string{aws.String(amiID)},
 	})
 	if err != nil {
-		return artifact, false, fmt.Errorf("could not get image block device mapping attribute for image %s: %v", amiID, err)
+		return fmt.Errorf("could not get image block device mapping attribute for image %s: %v", amiID, err)
 	}
 
-	if err := p.fixSnapshotsForImages(ui, imagesOutput.Images, ec2conn, amiPermissions); err != nil {
-		return artifact, false, err
+	return p.fixSnapshotsForImages(ui, imagesOutput.Images, ec2conn, kmsconn, amiPermissions, accountID)
+}
+
+// filterOwnerPermission removes any UserId in permissions that matches the caller's own account ID, since AWS
+// rejects ModifySnapshotAttribute calls that grant createVolumePermission to the snapshot's owner.
+func filterOwnerPermission(permissions []*ec2.LaunchPermission, accountID string) []*ec2.LaunchPermission {
+	filtered := []*ec2.LaunchPermission{}
+	for _, permission := range permissions {
+		if permission.UserId != nil && aws.StringValue(permission.UserId) == accountID {
+			continue
+		}
+		filtered = append(filtered, permission)
 	}
+	return filtered
+}
 
-	return artifact, true, nil
+// mergeLaunchPermissions combines the AMI's existing launch permissions with the explicitly configured
+// snapshot_users/snapshot_groups, deduplicating by UserId/Group so the same account or group isn't granted twice.
+func mergeLaunchPermissions(amiPermissions []*ec2.LaunchPermission, snapshotUsers []string, snapshotGroups []string) []*ec2.LaunchPermission {
+	seenUsers := map[string]bool{}
+	seenGroups := map[string]bool{}
+	merged := []*ec2.LaunchPermission{}
+
+	for _, permission := range amiPermissions {
+		if permission.UserId != nil {
+			if seenUsers[aws.StringValue(permission.UserId)] {
+				continue
+			}
+			seenUsers[aws.StringValue(permission.UserId)] = true
+		}
+		if permission.Group != nil {
+			if seenGroups[aws.StringValue(permission.Group)] {
+				continue
+			}
+			seenGroups[aws.StringValue(permission.Group)] = true
+		}
+		merged = append(merged, permission)
+	}
+
+	for _, userID := range snapshotUsers {
+		if seenUsers[userID] {
+			continue
+		}
+		seenUsers[userID] = true
+		merged = append(merged, &ec2.LaunchPermission{UserId: aws.String(userID)})
+	}
+
+	for _, group := range snapshotGroups {
+		if seenGroups[group] {
+			continue
+		}
+		seenGroups[group] = true
+		merged = append(merged, &ec2.LaunchPermission{Group: aws.String(group)})
+	}
+
+	return merged
 }
 
-func (p *PostProcessor) fixSnapshotsForImages(ui packer.Ui, images []*ec2.Image, ec2conn *ec2.EC2, amiPermissions []*ec2.LaunchPermission) error {
+func (p *PostProcessor) fixSnapshotsForImages(ui packer.Ui, images []*ec2.Image, ec2conn *ec2.EC2, kmsconn *kms.KMS, amiPermissions []*ec2.LaunchPermission, accountID string) error {
 	foundSnapshotDevice := false
 	for _, image := range images {
 		for _, device := range image.BlockDeviceMappings {
@@ -115,7 +269,13 @@ func (p *PostProcessor) fixSnapshotsForImages(ui packer.Ui, images []*ec2.Image,
 				if device.Ebs.SnapshotId != nil {
 					foundSnapshotDevice = true
 					snapshotID := aws.StringValue(device.Ebs.SnapshotId)
-					if err := p.fixSnapshotPermissions(ui, ec2conn, snapshotID, amiPermissions); err != nil {
+					ownedByCaller, err := p.fixSnapshotPermissions(ui, ec2conn, kmsconn, snapshotID, amiPermissions, accountID)
+					if err != nil {
+						return err
+					}
+					if !ownedByCaller {
+						ui.Say(fmt.Sprintf("Skipping tags for snapshot %s: not owned by the caller's account", snapshotID))
+					} else if err := p.tagSnapshot(ui, ec2conn, snapshotID, image); err != nil {
 						return err
 					}
 				}
@@ -130,24 +290,266 @@ func (p *PostProcessor) fixSnapshotsForImages(ui packer.Ui, images []*ec2.Image,
 	return nil
 }
 
-func (p *PostProcessor) fixSnapshotPermissions(ui packer.Ui, ec2conn *ec2.EC2, snapshotID string, amiPermissions []*ec2.LaunchPermission) error {
+// fixSnapshotPermissions converges the snapshot's createVolumePermission entries (and, for encrypted snapshots,
+// its KMS grants) on the desired state. The returned bool reports whether the snapshot is owned by the caller's
+// account; when it isn't, no permissions are modified and the caller should skip any further per-snapshot
+// mutations (e.g. tagging), since those also require ownership.
+func (p *PostProcessor) fixSnapshotPermissions(ui packer.Ui, ec2conn *ec2.EC2, kmsconn *kms.KMS, snapshotID string, amiPermissions []*ec2.LaunchPermission, accountID string) (bool, error) {
 	ui.Say(fmt.Sprintf("Snapshot ID: %s", snapshotID))
 
-	snapshotPermissions := []*ec2.CreateVolumePermission{}
+	snapshotsOutput, err := ec2conn.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		SnapshotIds: []*string{aws.String(snapshotID)},
+	})
+	if err != nil {
+		return false, fmt.Errorf("could not describe snapshot %s: %v", snapshotID, err)
+	}
+	if len(snapshotsOutput.Snapshots) != 1 {
+		return false, fmt.Errorf("expected to find exactly one snapshot for ID %s, found %d", snapshotID, len(snapshotsOutput.Snapshots))
+	}
+	snapshot := snapshotsOutput.Snapshots[0]
+	snapshotOwnerID := aws.StringValue(snapshot.OwnerId)
+	if snapshotOwnerID != accountID {
+		ui.Say(fmt.Sprintf("Skipping snapshot %s: owned by account %s, not the caller's account %s. "+
+			"ModifySnapshotAttribute can only be called by the snapshot owner.", snapshotID, snapshotOwnerID, accountID))
+		return false, nil
+	}
+
+	desiredPermissions := []*ec2.CreateVolumePermission{}
 	for _, amiPermission := range amiPermissions {
-		snapshotPermissions = append(snapshotPermissions, &ec2.CreateVolumePermission{Group: amiPermission.Group, UserId: amiPermission.UserId})
+		desiredPermissions = append(desiredPermissions, &ec2.CreateVolumePermission{Group: amiPermission.Group, UserId: amiPermission.UserId})
+	}
+
+	toAdd := desiredPermissions
+	toRemove := []*ec2.CreateVolumePermission{}
+
+	if p.config.RemoveMissing {
+		attributeOutput, err := ec2conn.DescribeSnapshotAttribute(&ec2.DescribeSnapshotAttributeInput{
+			Attribute:  aws.String(ec2.SnapshotAttributeNameCreateVolumePermission),
+			SnapshotId: aws.String(snapshotID),
+		})
+		if err != nil {
+			return true, fmt.Errorf("could not describe snapshot attributes for snapshot %s: %v", snapshotID, err)
+		}
+
+		toAdd, toRemove = diffCreateVolumePermissions(attributeOutput.CreateVolumePermissions, desiredPermissions)
+	}
+
+	ui.Say(fmt.Sprintf("Snapshot permissions to add: %v", toAdd))
+	if len(toRemove) > 0 {
+		ui.Say(fmt.Sprintf("Snapshot permissions to remove: %v", toRemove))
 	}
 
-	ui.Say(fmt.Sprintf("Snapshot Permissions: %v", snapshotPermissions))
+	if len(toAdd) == 0 && len(toRemove) == 0 {
+		ui.Say("Snapshot permissions already match the desired state, nothing to do")
+		return true, p.grantKMSAccess(ui, kmsconn, snapshot, desiredPermissions)
+	}
+
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("dry_run is set, skipping ModifySnapshotAttribute call for snapshot %s", snapshotID))
+		return true, p.grantKMSAccess(ui, kmsconn, snapshot, desiredPermissions)
+	}
 
-	_, err := ec2conn.ModifySnapshotAttribute(&ec2.ModifySnapshotAttributeInput{
+	_, err = ec2conn.ModifySnapshotAttribute(&ec2.ModifySnapshotAttributeInput{
 		SnapshotId: aws.String(snapshotID),
 		CreateVolumePermission: &ec2.CreateVolumePermissionModifications{
-			Add: snapshotPermissions,
+			Add:    toAdd,
+			Remove: toRemove,
 		}})
 	if err != nil {
-		return fmt.Errorf("could not modify snapshot attributes: %v", err)
+		return true, fmt.Errorf("could not modify snapshot attributes: %v", err)
+	}
+
+	return true, p.grantKMSAccess(ui, kmsconn, snapshot, desiredPermissions)
+}
+
+// requiredKMSGrantOperations is the set of KMS operations a grantee needs to copy and decrypt a shared, encrypted
+// snapshot.
+var requiredKMSGrantOperations = []string{
+	kms.GrantOperationDecrypt,
+	kms.GrantOperationDescribeKey,
+	kms.GrantOperationCreateGrant,
+	kms.GrantOperationReEncryptFrom,
+}
+
+// grantKMSAccess ensures a KMS grant exists allowing each UserId in the snapshot's full desired permission set to
+// decrypt the given snapshot, when the snapshot is encrypted. Grants are requested on whichever key the snapshot's
+// KmsKeyId names; whether that key is customer-managed or AWS-managed is not checked. Group-based permissions
+// (e.g. "all") are skipped since KMS grants require a specific IAM principal.
+//
+// Unlike ModifySnapshotAttribute, kms.CreateGrant is not idempotent: calling it again for a grantee that already
+// holds a grant simply creates a second, redundant one. So existing grants on the key are listed first, and
+// CreateGrant is only called for grantees that don't already hold a grant covering every operation in
+// requiredKMSGrantOperations — a grantee's unrelated, narrower-scoped grant (e.g. Decrypt-only) must not be
+// mistaken for one that satisfies this tool's requirements.
+func (p *PostProcessor) grantKMSAccess(ui packer.Ui, kmsconn *kms.KMS, snapshot *ec2.Snapshot, desiredPermissions []*ec2.CreateVolumePermission) error {
+	if !aws.BoolValue(snapshot.Encrypted) {
+		return nil
+	}
+
+	keyID := aws.StringValue(snapshot.KmsKeyId)
+	snapshotID := aws.StringValue(snapshot.SnapshotId)
+
+	userPermissions := []*ec2.CreateVolumePermission{}
+	for _, permission := range desiredPermissions {
+		if permission.UserId != nil {
+			userPermissions = append(userPermissions, permission)
+		}
+	}
+
+	if len(userPermissions) == 0 {
+		ui.Say(fmt.Sprintf("Snapshot %s is encrypted but no user-scoped permissions were supplied; skipping KMS grant creation", snapshotID))
+		return nil
+	}
+
+	existingGranteeOperations := map[string][]map[string]bool{}
+	err := kmsconn.ListGrantsPages(&kms.ListGrantsInput{KeyId: aws.String(keyID)}, func(page *kms.ListGrantsResponse, lastPage bool) bool {
+		for _, grant := range page.Grants {
+			principal := aws.StringValue(grant.GranteePrincipal)
+			operations := map[string]bool{}
+			for _, operation := range grant.Operations {
+				operations[aws.StringValue(operation)] = true
+			}
+			existingGranteeOperations[principal] = append(existingGranteeOperations[principal], operations)
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("could not list KMS grants for key %s: %v", keyID, err)
+	}
+
+	for _, permission := range userPermissions {
+		granteePrincipal := fmt.Sprintf("arn:aws:iam::%s:root", aws.StringValue(permission.UserId))
+
+		if grantSatisfiesRequiredOperations(existingGranteeOperations[granteePrincipal], requiredKMSGrantOperations) {
+			ui.Say(fmt.Sprintf("KMS grant on %s for %s with the required operations already exists, skipping", keyID, granteePrincipal))
+			continue
+		}
+
+		grantName := fmt.Sprintf("%s%s-%s", p.config.KMSGrantNamePrefix, snapshotID, aws.StringValue(permission.UserId))
+
+		ui.Say(fmt.Sprintf("Creating KMS grant on %s for %s", keyID, granteePrincipal))
+
+		if p.config.DryRun {
+			ui.Say(fmt.Sprintf("dry_run is set, skipping CreateGrant call for key %s", keyID))
+			continue
+		}
+
+		_, err := kmsconn.CreateGrant(&kms.CreateGrantInput{
+			KeyId:            aws.String(keyID),
+			GranteePrincipal: aws.String(granteePrincipal),
+			Name:             aws.String(grantName),
+			Operations:       aws.StringSlice(requiredKMSGrantOperations),
+		})
+		if err != nil {
+			return fmt.Errorf("could not create KMS grant on key %s for %s: %v", keyID, granteePrincipal, err)
+		}
 	}
 
 	return nil
 }
+
+// grantSatisfiesRequiredOperations reports whether any of a grantee's existing grants (each given as its set of
+// operations) already covers every operation in required, so that grant can be relied on instead of creating a
+// new one.
+func grantSatisfiesRequiredOperations(existingGrantOperations []map[string]bool, required []string) bool {
+	for _, operations := range existingGrantOperations {
+		satisfied := true
+		for _, operation := range required {
+			if !operations[operation] {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// tagSnapshot applies the configured tags to a snapshot: tags copied from the source AMI (when copy_tags is set)
+// merged with the statically configured snapshot_tags, with snapshot_tags taking precedence on key collisions.
+// Packer's older EBS builders often leave snapshots untagged, which breaks cost-allocation and lifecycle policies
+// that key off tags, so this backfills them alongside the permission fix already applied to the snapshot.
+func (p *PostProcessor) tagSnapshot(ui packer.Ui, ec2conn *ec2.EC2, snapshotID string, image *ec2.Image) error {
+	if !p.config.CopyTags && len(p.config.SnapshotTags) == 0 {
+		return nil
+	}
+
+	tags := map[string]string{}
+
+	if p.config.CopyTags {
+		tagsOutput, err := ec2conn.DescribeTags(&ec2.DescribeTagsInput{
+			Filters: []*ec2.Filter{
+				{Name: aws.String("resource-id"), Values: []*string{image.ImageId}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("could not describe tags for image %s: %v", aws.StringValue(image.ImageId), err)
+		}
+		for _, tag := range tagsOutput.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+
+	for key, value := range p.config.SnapshotTags {
+		tags[key] = value
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+
+	ec2Tags := make([]*ec2.Tag, 0, len(tags))
+	for key, value := range tags {
+		ec2Tags = append(ec2Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	ui.Say(fmt.Sprintf("Snapshot tags: %v", ec2Tags))
+
+	if p.config.DryRun {
+		ui.Say(fmt.Sprintf("dry_run is set, skipping CreateTags call for snapshot %s", snapshotID))
+		return nil
+	}
+
+	_, err := ec2conn.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String(snapshotID)},
+		Tags:      ec2Tags,
+	})
+	if err != nil {
+		return fmt.Errorf("could not create tags for snapshot %s: %v", snapshotID, err)
+	}
+
+	return nil
+}
+
+// diffCreateVolumePermissions compares the snapshot's current createVolumePermission entries against the desired
+// set and returns the entries that need to be added and removed for the snapshot's ACL to converge on the desired
+// state.
+func diffCreateVolumePermissions(current []*ec2.CreateVolumePermission, desired []*ec2.CreateVolumePermission) (toAdd []*ec2.CreateVolumePermission, toRemove []*ec2.CreateVolumePermission) {
+	currentByKey := map[string]*ec2.CreateVolumePermission{}
+	for _, permission := range current {
+		currentByKey[createVolumePermissionKey(permission)] = permission
+	}
+
+	desiredKeys := map[string]bool{}
+	for _, permission := range desired {
+		key := createVolumePermissionKey(permission)
+		desiredKeys[key] = true
+		if _, ok := currentByKey[key]; !ok {
+			toAdd = append(toAdd, permission)
+		}
+	}
+
+	for key, permission := range currentByKey {
+		if !desiredKeys[key] {
+			toRemove = append(toRemove, permission)
+		}
+	}
+
+	return toAdd, toRemove
+}
+
+func createVolumePermissionKey(permission *ec2.CreateVolumePermission) string {
+	return fmt.Sprintf("user:%s/group:%s", aws.StringValue(permission.UserId), aws.StringValue(permission.Group))
+}